@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/getlantern/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigCache persists the last-known-good cloud config to disk so that a
+// cold start with no network connectivity still has proxies to try, rather
+// than waiting on the first successful poll.
+type ConfigCache interface {
+	// Load returns the cached merged config bytes and the ETag they were
+	// fetched with. It returns nil bytes (and no error) if nothing has been
+	// cached yet.
+	Load() (cached []byte, cachedETag string, err error)
+
+	// Save atomically persists the merged runtime config alongside the
+	// ETag it was fetched with.
+	Save(merged []byte, fetchedETag string) error
+
+	// SaveUnprocessed persists the raw, pre-merge bytes as fetched from the
+	// config source, separately from the merged runtime config, so the two
+	// can be inspected or rolled back to independently.
+	SaveUnprocessed(raw []byte) error
+}
+
+// fileConfigCache is a ConfigCache backed by a user-scoped directory on
+// disk. Writes go through a temp file, fsync and rename so a crash or power
+// loss mid-write can never leave a half-written cache file behind.
+type fileConfigCache struct {
+	dir string
+}
+
+// NewFileConfigCache creates a ConfigCache rooted at dir, which is created
+// if it doesn't already exist.
+func NewFileConfigCache(dir string) (ConfigCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err).WithOp("mkdir").With("dir", dir)
+	}
+	return &fileConfigCache{dir: dir}, nil
+}
+
+func (c *fileConfigCache) mergedPath() string      { return filepath.Join(c.dir, "cloud.yaml") }
+func (c *fileConfigCache) etagPath() string        { return filepath.Join(c.dir, "cloud.yaml.etag") }
+func (c *fileConfigCache) unprocessedPath() string { return filepath.Join(c.dir, "cloud.yaml.raw") }
+
+// Load implements ConfigCache.
+func (c *fileConfigCache) Load() ([]byte, string, error) {
+	cached, err := ioutil.ReadFile(c.mergedPath())
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", errors.Wrap(err).WithOp("read-cache").With("path", c.mergedPath())
+	}
+	cachedETag, err := ioutil.ReadFile(c.etagPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", errors.Wrap(err).WithOp("read-cache-etag").With("path", c.etagPath())
+	}
+	return cached, string(cachedETag), nil
+}
+
+// Save implements ConfigCache.
+func (c *fileConfigCache) Save(merged []byte, fetchedETag string) error {
+	if err := atomicWrite(c.mergedPath(), merged); err != nil {
+		return errors.Wrap(err).WithOp("save-cache")
+	}
+	if fetchedETag != "" {
+		if err := atomicWrite(c.etagPath(), []byte(fetchedETag)); err != nil {
+			return errors.Wrap(err).WithOp("save-cache-etag")
+		}
+	}
+	return nil
+}
+
+// SaveUnprocessed implements ConfigCache.
+func (c *fileConfigCache) SaveUnprocessed(raw []byte) error {
+	if err := atomicWrite(c.unprocessedPath(), raw); err != nil {
+		return errors.Wrap(err).WithOp("save-cache-unprocessed")
+	}
+	return nil
+}
+
+// atomicWrite writes data to a temp file in the same directory as path,
+// fsyncs it and renames it over path, so readers never observe a partially
+// written file.
+func atomicWrite(path string, data []byte) error {
+	tmp := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// marshalConfig renders cfg back to YAML so it can be cached alongside the
+// unprocessed bytes it was merged from.
+func marshalConfig(cfg *Config) ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileConfigCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lantern-config-cache-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewFileConfigCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileConfigCache: %v", err)
+	}
+
+	cached, cachedETag, err := cache.Load()
+	if err != nil {
+		t.Fatalf("Load on empty cache: %v", err)
+	}
+	if cached != nil || cachedETag != "" {
+		t.Fatalf("expected empty cache, got cached=%v cachedETag=%q", cached, cachedETag)
+	}
+
+	merged := []byte("client:\n  chainedServers: {}\n")
+	if err := cache.Save(merged, "etag-1"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	raw := []byte("raw unprocessed bytes")
+	if err := cache.SaveUnprocessed(raw); err != nil {
+		t.Fatalf("SaveUnprocessed: %v", err)
+	}
+
+	loaded, loadedETag, err := cache.Load()
+	if err != nil {
+		t.Fatalf("Load after save: %v", err)
+	}
+	if string(loaded) != string(merged) {
+		t.Fatalf("loaded merged config = %q, want %q", loaded, merged)
+	}
+	if loadedETag != "etag-1" {
+		t.Fatalf("loaded etag = %q, want %q", loadedETag, "etag-1")
+	}
+
+	fc := cache.(*fileConfigCache)
+	rawOnDisk, err := ioutil.ReadFile(fc.unprocessedPath())
+	if err != nil {
+		t.Fatalf("reading unprocessed path: %v", err)
+	}
+	if string(rawOnDisk) != string(raw) {
+		t.Fatalf("unprocessed bytes on disk = %q, want %q", rawOnDisk, raw)
+	}
+
+	// Writes go through a temp file that's renamed into place; none should
+	// be left behind once Save/SaveUnprocessed return.
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Fatalf("leftover temp file %v in %v", e.Name(), dir)
+		}
+	}
+
+	// A second save should overwrite cleanly rather than erroring on an
+	// already-existing destination file.
+	if err := cache.Save([]byte("updated"), "etag-2"); err != nil {
+		t.Fatalf("second Save: %v", err)
+	}
+	loaded, loadedETag, err = cache.Load()
+	if err != nil {
+		t.Fatalf("Load after second save: %v", err)
+	}
+	if string(loaded) != "updated" || loadedETag != "etag-2" {
+		t.Fatalf("loaded = (%q, %q), want (%q, %q)", loaded, loadedETag, "updated", "etag-2")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cloud.yaml")); err != nil {
+		t.Fatalf("expected cloud.yaml to exist: %v", err)
+	}
+}
@@ -1,31 +1,11 @@
 package config
 
 import (
-	"compress/gzip"
-	"io/ioutil"
-	"math/rand"
-	"net/http"
-	"net/http/httputil"
 	"time"
 
 	"github.com/getlantern/errors"
 	"github.com/getlantern/flashlight/util"
 	"github.com/getlantern/yamlconf"
-
-	"code.google.com/p/go-uuid/uuid"
-)
-
-const (
-	etag                  = "X-Lantern-Etag"
-	ifNoneMatch           = "X-Lantern-If-None-Match"
-	userIDHeader          = "X-Lantern-User-Id"
-	tokenHeader           = "X-Lantern-Pro-Token"
-	chainedCloudConfigURL = "http://config.getiantem.org/cloud.yaml.gz"
-
-	// This is over HTTP because proxies do not forward X-Forwarded-For with HTTPS
-	// and because we only support falling back to direct domain fronting through
-	// the local proxy for HTTP.
-	frontedCloudConfigURL = "http://d2wi0vwulmtn99.cloudfront.net/cloud.yaml.gz"
 )
 
 var (
@@ -34,11 +14,18 @@ var (
 	CloudConfigPollInterval = 1 * time.Minute
 )
 
-// fetcher periodically fetches the latest cloud configuration.
+// fetcher periodically fetches the latest cloud configuration, trying each
+// of its sources in priority order until one delivers bytes or every source
+// has failed.
 type fetcher struct {
-	lastCloudConfigETag map[string]string
-	user                UserConfig
-	httpFetcher         util.HTTPFetcher
+	sources   []ConfigSource
+	cache     ConfigCache
+	scheduler *AdaptiveScheduler
+
+	// pendingCached holds config bytes loaded from cache at startup, to be
+	// merged on the very first poll before any network I/O happens. It's
+	// cleared after that first poll regardless of outcome.
+	pendingCached []byte
 }
 
 // UserConfig retrieves any custom user info for fetching the config.
@@ -47,10 +34,40 @@ type UserConfig interface {
 	GetToken() string
 }
 
-// NewFetcher creates a new configuration fetcher with the specified
-// interface for obtaining the user ID and token if those are populated.
-func NewFetcher(conf UserConfig, httpFetcher util.HTTPFetcher) Fetcher {
-	return &fetcher{lastCloudConfigETag: map[string]string{}, user: conf, httpFetcher: httpFetcher}
+// NewFetcher creates a new configuration fetcher that tries sources in the
+// order given, falling back to a CloudSource wired up with a fresh
+// AdaptiveScheduler and Metrics registry if none are provided. If cache is
+// non-nil, NewFetcher seeds the fetcher (and any CloudSource among sources)
+// from it before any network I/O, so a cold start with no connectivity
+// still has the last-known-good proxies to try.
+func NewFetcher(conf UserConfig, httpFetcher util.HTTPFetcher, cache ConfigCache, sources ...ConfigSource) Fetcher {
+	scheduler := NewAdaptiveScheduler(CloudConfigPollInterval, maxPollInterval)
+	if len(sources) == 0 {
+		sources = []ConfigSource{NewCloudSource(conf, httpFetcher, scheduler, NewMetrics())}
+	}
+	f := &fetcher{sources: sources, cache: cache, scheduler: scheduler}
+	if cache != nil {
+		if cached, cachedETag, err := cache.Load(); err != nil {
+			log.Debugf("Not seeding from config cache: %v", err)
+		} else if cached != nil {
+			f.pendingCached = cached
+			seedETags(sources, cachedETag)
+		}
+	}
+	return f
+}
+
+// seedETags pushes a cached ETag into any CloudSource among sources, so its
+// first real poll can send If-None-Match instead of blindly refetching.
+func seedETags(sources []ConfigSource, cachedETag string) {
+	if cachedETag == "" {
+		return
+	}
+	for _, src := range sources {
+		if cs, ok := src.(*CloudSource); ok {
+			cs.seedETag(cachedETag)
+		}
+	}
 }
 
 func (cf *fetcher) pollForConfig(currentCfg yamlconf.Config, stickyConfig bool) (mutate func(yamlconf.Config) error, waitTime time.Duration, err error) {
@@ -61,109 +78,106 @@ func (cf *fetcher) pollForConfig(currentCfg yamlconf.Config, stickyConfig bool)
 		return nil
 	}
 	cfg := currentCfg.(*Config)
-	waitTime = cf.cloudPollSleepTime()
+
+	if cf.pendingCached != nil {
+		// Apply the last-known-good cached config immediately, before any
+		// network I/O, so a cold start with no connectivity still has
+		// proxies to try. The network poll follows on the next call, which
+		// is scheduled with no wait.
+		cached := cf.pendingCached
+		cf.pendingCached = nil
+		log.Debugf("Seeded config from on-disk cache")
+		return cf.mergeMutator(cached, ""), 0, nil
+	}
+
 	if cfg.CloudConfig == "" {
 		log.Debugf("No cloud config URL!")
-		// Config doesn't have a CloudConfig, just ignore
-		return mutate, waitTime, nil
+		// Config doesn't have a CloudConfig, just ignore. No fetch was
+		// attempted, so there's nothing to feed the backoff/circuit breaker.
+		return mutate, cf.scheduler.NextInterval(true), nil
 	}
 	if stickyConfig {
 		log.Debugf("Not downloading remote config with sticky config flag set")
-		return mutate, waitTime, nil
+		// Same as above - no fetch attempted, so treat as healthy.
+		return mutate, cf.scheduler.NextInterval(true), nil
 	}
 
-	if bytes, err := cf.fetchCloudConfig(cfg); err != nil {
-		return mutate, waitTime, errors.Wrap(err).WithOp("fetch-cloud-config")
+	bytes, fetchErr := cf.fetchFromSources(cfg)
+	waitTime = cf.scheduler.NextInterval(fetchErr == nil)
+	if fetchErr != nil {
+		return mutate, waitTime, errors.Wrap(fetchErr).WithOp("fetch-cloud-config")
 	} else if bytes != nil {
 		// bytes will be nil if the config is unchanged (not modified)
-		mutate = func(ycfg yamlconf.Config) error {
-			log.Debugf("Merging cloud configuration")
-			cfg := ycfg.(*Config)
-
-			err := cfg.updateFrom(bytes)
-			if cfg.Client.ChainedServers != nil {
-				log.Debugf("Adding %d chained servers", len(cfg.Client.ChainedServers))
-				for _, s := range cfg.Client.ChainedServers {
-					log.Debugf("Got chained server: %v", s.Addr)
-				}
-			}
-			return err
-		}
+		mutate = cf.mergeMutator(bytes, cf.latestETag(cfg))
 	} else {
 		log.Debugf("Bytes are nil - config not modified.")
 	}
 	return mutate, waitTime, nil
 }
 
-func (cf *fetcher) fetchCloudConfig(cfg *Config) ([]byte, error) {
-	log.Debugf("Fetching cloud config from %v (%v)", cfg.CloudConfig, cfg.FrontedCloudConfig)
-
-	url := cfg.CloudConfig
-	cb := "?" + uuid.New()
-	nocache := url + cb
-	req, err := http.NewRequest("GET", nocache, nil)
-	if err != nil {
-		return nil, errors.Wrap(err).WithOp("NewRequest").With("url", nocache)
-	}
-	if cf.lastCloudConfigETag[url] != "" {
-		// Don't bother fetching if unchanged
-		req.Header.Set(ifNoneMatch, cf.lastCloudConfigETag[url])
-	}
-
-	req.Header.Set("Accept", "application/x-gzip")
-	// Prevents intermediate nodes (domain-fronters) from caching the content
-	req.Header.Set("Cache-Control", "no-cache")
-	// Set the fronted URL to lookup the config in parallel using chained and domain fronted servers.
-	req.Header.Set("Lantern-Fronted-URL", cfg.FrontedCloudConfig+cb)
-
-	id := cf.user.GetUserID()
-	if id != "" {
-		req.Header.Set(userIDHeader, id)
-	}
-	tok := cf.user.GetToken()
-	if tok != "" {
-		req.Header.Set(tokenHeader, tok)
+// mergeMutator builds a yamlconf mutate func that merges unprocessedBytes
+// into the runtime config and, if a ConfigCache is configured, writes both
+// the unprocessed bytes and the resulting merged config through to disk.
+func (cf *fetcher) mergeMutator(unprocessedBytes []byte, fetchedETag string) func(yamlconf.Config) error {
+	return func(ycfg yamlconf.Config) error {
+		log.Debugf("Merging cloud configuration")
+		cfg := ycfg.(*Config)
+
+		err := cfg.updateFrom(unprocessedBytes)
+		if cfg.Client.ChainedServers != nil {
+			log.Debugf("Adding %d chained servers", len(cfg.Client.ChainedServers))
+			for _, s := range cfg.Client.ChainedServers {
+				log.Debugf("Got chained server: %v", s.Addr)
+			}
+		}
+		if err == nil && cf.cache != nil {
+			cf.writeThroughCache(cfg, unprocessedBytes, fetchedETag)
+		}
+		return err
 	}
+}
 
-	// make sure to close the connection after reading the Body
-	// this prevents the occasional EOFs errors we're seeing with
-	// successive requests
-	req.Close = true
-
-	resp, err := cf.httpFetcher.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err).WithOp("fetch-cloud-config").With("url", url)
+// writeThroughCache persists the merged config and its unprocessed source
+// bytes to disk, logging rather than failing the poll if the write doesn't
+// succeed since the in-memory config is already up to date either way.
+func (cf *fetcher) writeThroughCache(cfg *Config, unprocessedBytes []byte, fetchedETag string) {
+	if err := cf.cache.SaveUnprocessed(unprocessedBytes); err != nil {
+		log.Debugf("Error caching unprocessed config: %v", err)
 	}
-	dump, err := httputil.DumpResponse(resp, false)
+	merged, err := marshalConfig(cfg)
 	if err != nil {
-		errors.Wrap(err).WithOp("dump-response").Report()
-	} else {
-		log.Debugf("Response headers: \n%v", string(dump))
+		log.Debugf("Error marshaling config for cache: %v", err)
+		return
 	}
-	defer func() {
-		if errr := resp.Body.Close(); errr != nil {
-			log.Debugf("Error closing response body: %v", errr)
-		}
-	}()
-
-	if resp.StatusCode == 304 {
-		log.Debugf("Config unchanged in cloud")
-		return nil, nil
-	} else if resp.StatusCode != 200 {
-		return nil, errors.New("Unexpected response status").Response(resp)
+	if err := cf.cache.Save(merged, fetchedETag); err != nil {
+		log.Debugf("Error caching merged config: %v", err)
 	}
+}
 
-	cf.lastCloudConfigETag[url] = resp.Header.Get(etag)
-	gzReader, err := gzip.NewReader(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err)
+// latestETag returns the ETag most recently recorded for cfg.CloudConfig by
+// a CloudSource, if one of cf.sources is a CloudSource.
+func (cf *fetcher) latestETag(cfg *Config) string {
+	for _, src := range cf.sources {
+		if cs, ok := src.(*CloudSource); ok {
+			return cs.lastCloudConfigETag[cfg.CloudConfig]
+		}
 	}
-	log.Debugf("Fetched cloud config")
-	return ioutil.ReadAll(gzReader)
+	return ""
 }
 
-// cloudPollSleepTime adds some randomization to our requests to make them
-// less distinguishing on the network.
-func (cf *fetcher) cloudPollSleepTime() time.Duration {
-	return time.Duration((CloudConfigPollInterval.Nanoseconds() / 2) + rand.Int63n(CloudConfigPollInterval.Nanoseconds()))
+// fetchFromSources tries each configured source in priority order, returning
+// the first one that delivers config bytes (or reports the config as
+// unchanged). It only returns an error if every source failed.
+func (cf *fetcher) fetchFromSources(cfg *Config) ([]byte, error) {
+	var lastErr error
+	for _, src := range cf.sources {
+		bytes, err := src.Fetch(cfg)
+		if err != nil {
+			log.Debugf("Config source %v failed: %v", src.Name(), err)
+			lastErr = err
+			continue
+		}
+		return bytes, nil
+	}
+	return nil, lastErr
 }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// stubSource is a ConfigSource whose Fetch result is fixed in advance, for
+// exercising fetchFromSources' fallback behavior without real network I/O.
+type stubSource struct {
+	name  string
+	bytes []byte
+	err   error
+}
+
+func (s *stubSource) Name() string                      { return s.name }
+func (s *stubSource) Fetch(cfg *Config) ([]byte, error) { return s.bytes, s.err }
+
+func TestFetchFromSourcesFallsBackToNextOnError(t *testing.T) {
+	first := &stubSource{name: "first", err: errors.New("first unreachable")}
+	second := &stubSource{name: "second", bytes: []byte("config bytes")}
+	cf := &fetcher{sources: []ConfigSource{first, second}}
+
+	bytes, err := cf.fetchFromSources(&Config{})
+	if err != nil {
+		t.Fatalf("fetchFromSources: %v", err)
+	}
+	if string(bytes) != "config bytes" {
+		t.Fatalf("bytes = %q, want %q", bytes, "config bytes")
+	}
+}
+
+func TestFetchFromSourcesReturnsErrorWhenAllFail(t *testing.T) {
+	first := &stubSource{name: "first", err: errors.New("first unreachable")}
+	second := &stubSource{name: "second", err: errors.New("second unreachable")}
+	cf := &fetcher{sources: []ConfigSource{first, second}}
+
+	_, err := cf.fetchFromSources(&Config{})
+	if err == nil {
+		t.Fatalf("expected an error when every source fails")
+	}
+	if err.Error() != "second unreachable" {
+		t.Fatalf("expected the last source's error to be returned, got %v", err)
+	}
+}
+
+func TestFetchFromSourcesStopsOnNotModified(t *testing.T) {
+	// A source reporting nil bytes, nil error means "unchanged" and should
+	// be treated as a successful fetch - fetchFromSources shouldn't fall
+	// through to later sources.
+	first := &stubSource{name: "first"}
+	second := &stubSource{name: "second", bytes: []byte("should not be used")}
+	cf := &fetcher{sources: []ConfigSource{first, second}}
+
+	bytes, err := cf.fetchFromSources(&Config{})
+	if err != nil {
+		t.Fatalf("fetchFromSources: %v", err)
+	}
+	if bytes != nil {
+		t.Fatalf("expected nil bytes for an unchanged config, got %q", bytes)
+	}
+}
+
+// stubCache is a ConfigCache recording what was passed to Save/SaveUnprocessed,
+// for asserting writeThroughCache's write-through behavior.
+type stubCache struct {
+	savedMerged   []byte
+	savedETag     string
+	savedRaw      []byte
+	saveErr       error
+	saveUnprocErr error
+}
+
+func (c *stubCache) Load() ([]byte, string, error) { return nil, "", nil }
+
+func (c *stubCache) Save(merged []byte, fetchedETag string) error {
+	c.savedMerged = merged
+	c.savedETag = fetchedETag
+	return c.saveErr
+}
+
+func (c *stubCache) SaveUnprocessed(raw []byte) error {
+	c.savedRaw = raw
+	return c.saveUnprocErr
+}
+
+func TestWriteThroughCacheSavesRawAndMergedConfig(t *testing.T) {
+	cache := &stubCache{}
+	cf := &fetcher{cache: cache}
+
+	raw := []byte("raw fetched bytes")
+	cf.writeThroughCache(&Config{}, raw, "etag-123")
+
+	if string(cache.savedRaw) != string(raw) {
+		t.Fatalf("savedRaw = %q, want %q", cache.savedRaw, raw)
+	}
+	if cache.savedETag != "etag-123" {
+		t.Fatalf("savedETag = %q, want %q", cache.savedETag, "etag-123")
+	}
+	if cache.savedMerged == nil {
+		t.Fatalf("expected a marshaled merged config to be saved")
+	}
+}
+
+func TestWriteThroughCacheToleratesSaveErrors(t *testing.T) {
+	// writeThroughCache only logs cache write failures; the in-memory
+	// config is already up to date either way, so it must not panic or
+	// otherwise propagate the error.
+	cache := &stubCache{saveErr: errors.New("disk full"), saveUnprocErr: errors.New("disk full")}
+	cf := &fetcher{cache: cache}
+
+	cf.writeThroughCache(&Config{}, []byte("raw"), "etag")
+}
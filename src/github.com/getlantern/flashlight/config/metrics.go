@@ -0,0 +1,37 @@
+package config
+
+import (
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+// fetchResult labels the outcome of a single config fetch attempt for
+// metrics purposes.
+type fetchResult string
+
+const (
+	resultSuccess     fetchResult = "success"
+	resultNotModified fetchResult = "not_modified"
+	resultError       fetchResult = "error"
+)
+
+// Metrics reports config fetch outcomes via ops, so operators can alert on
+// stalled polls or a transport that's stopped delivering configs.
+type Metrics struct{}
+
+// NewMetrics creates a Metrics reporter.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// RecordFetch reports the outcome and duration of a single fetch attempt
+// against a single transport (e.g. "chained+fronted", "fronted-only", or a
+// ConfigSource's Name()).
+func (m *Metrics) RecordFetch(result fetchResult, transport string, d time.Duration) {
+	op := ops.Begin("config_fetch")
+	defer op.End()
+	op.Set("result", string(result))
+	op.Set("transport", transport)
+	op.Set("duration_seconds", d.Seconds())
+}
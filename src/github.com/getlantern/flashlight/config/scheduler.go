@@ -0,0 +1,112 @@
+package config
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitBreakerThreshold is how many consecutive failures against a URL
+	// trip its circuit breaker.
+	circuitBreakerThreshold = 3
+
+	// circuitBreakerCooldown is how long a tripped circuit stays open
+	// before the scheduler allows that URL to be tried again.
+	circuitBreakerCooldown = 5 * time.Minute
+
+	// maxPollInterval caps the exponential backoff applied once every
+	// configured URL is failing.
+	maxPollInterval = 30 * time.Minute
+)
+
+// urlHealth tracks the recent failure history of a single config URL.
+type urlHealth struct {
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+func (h *urlHealth) isOpen(now time.Time) bool {
+	return !h.openUntil.IsZero() && now.Before(h.openUntil)
+}
+
+// AdaptiveScheduler replaces a fixed polling interval with one that reacts
+// to which config URLs are actually succeeding. It trips a circuit breaker
+// against a URL after repeated consecutive failures so callers can shift to
+// an alternate path (e.g. fronted-only), and once every known URL is
+// failing it backs the poll interval off exponentially, capped, with
+// decorrelated jitter rather than hammering a blocked endpoint on a fixed
+// cadence.
+type AdaptiveScheduler struct {
+	mu   sync.Mutex
+	base time.Duration
+	max  time.Duration
+	prev time.Duration
+	urls map[string]*urlHealth
+}
+
+// NewAdaptiveScheduler creates a scheduler whose poll interval floors at
+// base (the healthy-path interval) and never exceeds max.
+func NewAdaptiveScheduler(base, max time.Duration) *AdaptiveScheduler {
+	return &AdaptiveScheduler{base: base, max: max, prev: base, urls: map[string]*urlHealth{}}
+}
+
+// RecordResult updates url's circuit breaker state following a fetch
+// attempt.
+func (s *AdaptiveScheduler) RecordResult(url string, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.healthFor(url)
+	if success {
+		h.consecutiveFailures = 0
+		h.openUntil = time.Time{}
+		return
+	}
+	h.consecutiveFailures++
+	if h.consecutiveFailures >= circuitBreakerThreshold {
+		h.openUntil = time.Now().Add(circuitBreakerCooldown)
+	}
+}
+
+// CircuitOpen reports whether url's circuit breaker is presently open,
+// meaning callers should prefer an alternate path instead.
+func (s *AdaptiveScheduler) CircuitOpen(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthFor(url).isOpen(time.Now())
+}
+
+func (s *AdaptiveScheduler) healthFor(url string) *urlHealth {
+	h, ok := s.urls[url]
+	if !ok {
+		h = &urlHealth{}
+		s.urls[url] = h
+	}
+	return h
+}
+
+// NextInterval returns the next poll interval. When allHealthy is true it
+// resets to a jittered interval around base, uniformly distributed over
+// [base/2, base*3/2] like the original fixed-cadence poller. When false
+// (every configured URL presently failing), it grows the interval using
+// decorrelated jitter: sleep = min(cap, random_between(base, prev*3)).
+func (s *AdaptiveScheduler) NextInterval(allHealthy bool) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if allHealthy {
+		s.prev = s.base
+		return time.Duration(int64(s.base)/2 + rand.Int63n(int64(s.base)))
+	}
+
+	spread := int64(s.prev)*3 - int64(s.base)
+	if spread < 1 {
+		spread = 1
+	}
+	next := s.base + time.Duration(rand.Int63n(spread))
+	if next > s.max {
+		next = s.max
+	}
+	s.prev = next
+	return next
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextIntervalGrowsOnRepeatedFailures(t *testing.T) {
+	base := time.Minute
+	max := 30 * time.Minute
+	s := NewAdaptiveScheduler(base, max)
+
+	// The first failure's interval must fall within the original
+	// [base, 3*base) range described by NextInterval's doc comment.
+	first := s.NextInterval(false)
+	if first < base || first >= 3*base {
+		t.Fatalf("first failure interval %v out of range [%v, %v)", first, base, 3*base)
+	}
+
+	// Each subsequent call should only ever grow the upper bound of the
+	// possible range (sleep = min(cap, random_between(base, prev*3))), so
+	// enough repeated failures must eventually exceed the first-failure
+	// range and never exceed max. This is exactly what would have caught
+	// the bug where a throwaway optimistic NextInterval(true) call reset
+	// prev every poll and capped backoff at the first-failure range forever.
+	grewPastFirstRange := false
+	last := first
+	for i := 0; i < 200; i++ {
+		last = s.NextInterval(false)
+		if last > max {
+			t.Fatalf("interval %v exceeded max %v", last, max)
+		}
+		if last >= 3*base {
+			grewPastFirstRange = true
+			break
+		}
+	}
+	if !grewPastFirstRange {
+		t.Fatalf("interval never grew past the first-failure range after 200 failures; last=%v", last)
+	}
+}
+
+func TestNextIntervalResetsOnHealthy(t *testing.T) {
+	base := time.Minute
+	max := 30 * time.Minute
+	s := NewAdaptiveScheduler(base, max)
+
+	for i := 0; i < 50; i++ {
+		s.NextInterval(false)
+	}
+
+	reset := s.NextInterval(true)
+	if reset < base/2 || reset > 3*base/2 {
+		t.Fatalf("reset interval %v out of range [%v, %v]", reset, base/2, 3*base/2)
+	}
+
+	// prev should now be back at base, so the next failure falls back into
+	// the first-failure range rather than continuing to grow from before.
+	next := s.NextInterval(false)
+	if next < base || next >= 3*base {
+		t.Fatalf("interval after reset %v out of range [%v, %v)", next, base, 3*base)
+	}
+}
+
+func TestCircuitOpenTripsAfterThreshold(t *testing.T) {
+	s := NewAdaptiveScheduler(time.Minute, 30*time.Minute)
+	url := "http://example.com/cloud.yaml.gz"
+
+	if s.CircuitOpen(url) {
+		t.Fatalf("circuit should start closed")
+	}
+
+	for i := 0; i < circuitBreakerThreshold-1; i++ {
+		s.RecordResult(url, false)
+		if s.CircuitOpen(url) {
+			t.Fatalf("circuit opened after only %d failures, threshold is %d", i+1, circuitBreakerThreshold)
+		}
+	}
+
+	s.RecordResult(url, false)
+	if !s.CircuitOpen(url) {
+		t.Fatalf("circuit should be open after %d consecutive failures", circuitBreakerThreshold)
+	}
+
+	s.RecordResult(url, true)
+	if s.CircuitOpen(url) {
+		t.Fatalf("circuit should close immediately on a success")
+	}
+}
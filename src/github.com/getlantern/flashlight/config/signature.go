@@ -0,0 +1,115 @@
+package config
+
+import (
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrSignatureInvalid is returned by a ConfigSource's Fetch when a downloaded
+// config could not be verified against any pinned or operator-supplied key.
+// Callers should treat this the same as a transient fetch error and keep
+// serving the previously-good config rather than merging the new bytes.
+var ErrSignatureInvalid = errors.New("config signature verification failed")
+
+// RequireSignedCloudConfig gates enforcement of detached signature
+// verification on cloud.yaml.gz fetches. It defaults to false because, as
+// of this writing, the CDN doesn't yet serve .sig files and no production
+// key has replaced the placeholder in pinnedSigningKeys below — flipping
+// this on before then would turn every real-world fetch into a permanent
+// failure. Flip to true once a real signing key is pinned and the CDN is
+// serving signatures.
+var RequireSignedCloudConfig = false
+
+// TrustConfig lets callers inject additional trusted signing keys beyond the
+// ones pinned below, for example to support self-hosted config services that
+// sign with their own key.
+type TrustConfig interface {
+	// GetTrustedKeys returns additional raw 32-byte Ed25519 public keys that
+	// should be accepted when verifying config signatures, in addition to the
+	// keys pinned in this binary.
+	GetTrustedKeys() [][]byte
+}
+
+// signingKey pairs a pinned Ed25519 public key with the window during which
+// it's accepted. validUntil is the zero time for the currently active key,
+// meaning it never expires until replaced by a future pin.
+type signingKey struct {
+	key        ed25519.PublicKey
+	validFrom  time.Time
+	validUntil time.Time
+}
+
+// pinnedSigningKeys are the Ed25519 public keys embedded in this binary that
+// cloud.yaml.gz signatures are checked against. When rotating to a new key,
+// add it here with a validFrom in the future and give the outgoing key a
+// matching validUntil so both are accepted during the overlap window.
+//
+// The key below is a placeholder pending real signing infrastructure on the
+// CDN side; see RequireSignedCloudConfig.
+var pinnedSigningKeys = []signingKey{
+	{
+		// lantern-cloud-config-2016 (placeholder, not yet live)
+		key: ed25519.PublicKey{
+			0x4f, 0x3c, 0x8b, 0x1a, 0x9d, 0x2e, 0x7f, 0x05,
+			0xc6, 0x91, 0x3a, 0x8d, 0x0b, 0x2f, 0x5e, 0x74,
+			0x1d, 0x9a, 0x62, 0xf8, 0x3b, 0xc5, 0x07, 0xe2,
+			0x94, 0x6b, 0x1d, 0x80, 0xaf, 0x3e, 0x29, 0x55,
+		},
+	},
+}
+
+// isWithinWindow reports whether now falls within the key's acceptance
+// window.
+func (k signingKey) isWithinWindow(now time.Time) bool {
+	if !k.validFrom.IsZero() && now.Before(k.validFrom) {
+		return false
+	}
+	if !k.validUntil.IsZero() && now.After(k.validUntil) {
+		return false
+	}
+	return true
+}
+
+// verifyDetachedSignature reports whether sig is a valid Ed25519 signature
+// of data under any currently-active pinned key or any key supplied by
+// extraKeys (which are always considered active, since the operator
+// configuring them is trusted to manage their own rotation).
+func verifyDetachedSignature(data, sig []byte, extraKeys [][]byte) bool {
+	now := time.Now()
+	for _, k := range pinnedSigningKeys {
+		if k.isWithinWindow(now) && ed25519.Verify(k.key, data, sig) {
+			return true
+		}
+	}
+	for _, raw := range extraKeys {
+		if len(raw) != ed25519.PublicKeySize {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(raw), data, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedKeysFor returns any additional trusted keys contributed by conf, if
+// it implements TrustConfig.
+func trustedKeysFor(conf UserConfig) [][]byte {
+	if tc, ok := conf.(TrustConfig); ok {
+		return tc.GetTrustedKeys()
+	}
+	return nil
+}
+
+// reportSignatureFailure records an ops metric so operators can alert on a
+// config CDN serving unsigned or mis-signed manifests.
+func reportSignatureFailure(url string) {
+	op := ops.Begin("config_signature_invalid")
+	defer op.End()
+	op.Set("url", url)
+	log.Errorf("Signature verification failed for cloud config at %v", url)
+}
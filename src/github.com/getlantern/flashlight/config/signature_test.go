@@ -0,0 +1,125 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// withPinnedKey swaps pinnedSigningKeys for a single key for the duration of
+// a test, restoring the original afterward.
+func withPinnedKey(t *testing.T, k signingKey) {
+	orig := pinnedSigningKeys
+	pinnedSigningKeys = []signingKey{k}
+	t.Cleanup(func() { pinnedSigningKeys = orig })
+}
+
+func TestVerifyDetachedSignatureValid(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	withPinnedKey(t, signingKey{key: pub})
+
+	data := []byte("cloud config bytes")
+	sig := ed25519.Sign(priv, data)
+
+	if !verifyDetachedSignature(data, sig, nil) {
+		t.Fatalf("expected valid signature to be accepted")
+	}
+}
+
+func TestVerifyDetachedSignatureTamperedRejected(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	withPinnedKey(t, signingKey{key: pub})
+
+	data := []byte("cloud config bytes")
+	sig := ed25519.Sign(priv, data)
+
+	if verifyDetachedSignature([]byte("tampered config bytes"), sig, nil) {
+		t.Fatalf("expected tampered body to be rejected")
+	}
+
+	tamperedSig := append([]byte{}, sig...)
+	tamperedSig[0] ^= 0xff
+	if verifyDetachedSignature(data, tamperedSig, nil) {
+		t.Fatalf("expected tampered signature to be rejected")
+	}
+}
+
+func TestVerifyDetachedSignatureOutsideWindowRejected(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	// validUntil in the past: ed25519.Verify would pass, but the key's
+	// acceptance window has already closed.
+	withPinnedKey(t, signingKey{key: pub, validUntil: time.Now().Add(-time.Hour)})
+
+	data := []byte("cloud config bytes")
+	sig := ed25519.Sign(priv, data)
+
+	if verifyDetachedSignature(data, sig, nil) {
+		t.Fatalf("expected signature from an expired key to be rejected")
+	}
+}
+
+func TestVerifyDetachedSignatureTrustConfigKeyAccepted(t *testing.T) {
+	// No pinned key can verify this signature; only the operator-supplied
+	// extra key (as TrustConfig would provide) can.
+	withPinnedKey(t, signingKey{key: ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))})
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	data := []byte("self-hosted config bytes")
+	sig := ed25519.Sign(priv, data)
+
+	if verifyDetachedSignature(data, sig, nil) {
+		t.Fatalf("signature shouldn't verify against the pinned key alone")
+	}
+	if !verifyDetachedSignature(data, sig, [][]byte{[]byte(pub)}) {
+		t.Fatalf("expected signature to verify against an operator-supplied TrustConfig key")
+	}
+}
+
+type fakeTrustConfig struct {
+	keys [][]byte
+}
+
+func (f fakeTrustConfig) GetUserID() string { return "" }
+func (f fakeTrustConfig) GetToken() string  { return "" }
+func (f fakeTrustConfig) GetTrustedKeys() [][]byte {
+	return f.keys
+}
+
+func TestTrustedKeysFor(t *testing.T) {
+	extra := [][]byte{[]byte("some-key")}
+	if keys := trustedKeysFor(fakeTrustConfig{keys: extra}); len(keys) != 1 {
+		t.Fatalf("expected trustedKeysFor to surface TrustConfig's keys, got %v", keys)
+	}
+
+	// A UserConfig that doesn't implement TrustConfig contributes nothing.
+	if keys := trustedKeysFor(noTrustConfig{}); keys != nil {
+		t.Fatalf("expected no extra keys from a UserConfig without TrustConfig, got %v", keys)
+	}
+}
+
+type noTrustConfig struct{}
+
+func (noTrustConfig) GetUserID() string { return "" }
+func (noTrustConfig) GetToken() string  { return "" }
+
+func TestRequireSignedCloudConfigDefaultsFalse(t *testing.T) {
+	// CloudSource.Fetch only enforces signature verification when this is
+	// true; it must default to false until a real key and CDN-side signing
+	// are in place, or every real-world fetch would fail.
+	if RequireSignedCloudConfig {
+		t.Fatalf("RequireSignedCloudConfig must default to false")
+	}
+}
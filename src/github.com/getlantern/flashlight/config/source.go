@@ -0,0 +1,15 @@
+package config
+
+// ConfigSource knows how to retrieve the latest cloud configuration for a
+// given Config. Fetchers try sources in priority order on each poll, moving
+// on to the next source if one fails, so operators can layer a self-hosted
+// ExternalHTTPSource in front of or behind the stock CloudSource without
+// patching the binary.
+type ConfigSource interface {
+	// Name identifies the source for logging and metrics.
+	Name() string
+
+	// Fetch retrieves the latest config bytes (already decompressed YAML).
+	// It returns nil bytes, nil error if the config is unchanged.
+	Fetch(cfg *Config) ([]byte, error)
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/flashlight/util"
+
+	"code.google.com/p/go-uuid/uuid"
+)
+
+const (
+	etag                  = "X-Lantern-Etag"
+	ifNoneMatch           = "X-Lantern-If-None-Match"
+	userIDHeader          = "X-Lantern-User-Id"
+	tokenHeader           = "X-Lantern-Pro-Token"
+	chainedCloudConfigURL = "http://config.getiantem.org/cloud.yaml.gz"
+
+	// This is over HTTP because proxies do not forward X-Forwarded-For with HTTPS
+	// and because we only support falling back to direct domain fronting through
+	// the local proxy for HTTP.
+	frontedCloudConfigURL = "http://d2wi0vwulmtn99.cloudfront.net/cloud.yaml.gz"
+
+	// sigSuffix is appended to a cloud config URL to locate its detached
+	// signature.
+	sigSuffix = ".sig"
+)
+
+// CloudSource is the original Lantern config source: it fetches
+// cloud.yaml.gz over chained and domain-fronted HTTP in parallel. It verifies
+// the result against a detached, pinned signature only when
+// RequireSignedCloudConfig is true; with the default of false, the body is
+// merged without any signature check.
+type CloudSource struct {
+	lastCloudConfigETag map[string]string
+	user                UserConfig
+	httpFetcher         util.HTTPFetcher
+	h3Fetcher           *util.H3Fetcher
+	scheduler           *AdaptiveScheduler
+	metrics             *Metrics
+
+	// seededETag is an ETag seeded from an on-disk cache at startup. It's
+	// used as the If-None-Match value for the first real poll only, since
+	// after that lastCloudConfigETag has taken over.
+	seededETag string
+}
+
+// NewCloudSource creates the stock chained+fronted ConfigSource. scheduler
+// tracks per-URL health so Fetch can fall back to fronted-only once the
+// chained path's circuit breaker trips; metrics records fetch outcomes for
+// operators to scrape. Either may be nil to opt out.
+func NewCloudSource(conf UserConfig, httpFetcher util.HTTPFetcher, scheduler *AdaptiveScheduler, metrics *Metrics) *CloudSource {
+	return &CloudSource{
+		lastCloudConfigETag: map[string]string{},
+		user:                conf,
+		httpFetcher:         httpFetcher,
+		scheduler:           scheduler,
+		metrics:             metrics,
+	}
+}
+
+// Name implements ConfigSource.
+func (cs *CloudSource) Name() string {
+	return "cloud"
+}
+
+// seedETag records an ETag loaded from an on-disk config cache so the
+// first poll after startup can send it as If-None-Match rather than
+// blindly refetching a config we already have.
+func (cs *CloudSource) seedETag(cachedETag string) {
+	cs.seededETag = cachedETag
+}
+
+// httpFetcherFor returns the transport to use for this poll. If cfg
+// specifies CloudConfigProtocols (e.g. []string{"h3", "h2", "h1"}), it
+// builds a fallback chain that tries those transports in the order given.
+// "h3" is served by a single H3Fetcher (HTTP/1.1-style requests over QUIC,
+// not HTTP/3 framing) reused across polls so its TLS session ticket cache
+// can offer 0-RTT resumption; "h2" and "h1" both use httpFetcher.
+func (cs *CloudSource) httpFetcherFor(cfg *Config) util.HTTPFetcher {
+	if len(cfg.CloudConfigProtocols) == 0 {
+		return cs.httpFetcher
+	}
+	if cs.h3Fetcher == nil {
+		if addr, err := quicAddr(cfg.CloudConfig); err == nil {
+			cs.h3Fetcher = util.NewH3Fetcher(addr)
+		}
+	}
+	fetchers := map[string]util.HTTPFetcher{"h2": cs.httpFetcher, "h1": cs.httpFetcher}
+	if cs.h3Fetcher != nil {
+		fetchers["h3"] = cs.h3Fetcher
+	}
+	return util.NewProtocolFetcher(cfg.CloudConfigProtocols, fetchers)
+}
+
+// quicAddr turns a cloud config URL into a host:port suitable for dialing
+// QUIC, defaulting to port 443 when the URL doesn't specify one.
+func quicAddr(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return u.Hostname() + ":443", nil
+}
+
+// Fetch implements ConfigSource. If the scheduler's circuit breaker has
+// tripped on cfg.CloudConfig after repeated consecutive failures, it shifts
+// to fetching fronted-only for the cooldown window instead of the usual
+// chained+fronted race.
+func (cs *CloudSource) Fetch(cfg *Config) (result []byte, err error) {
+	transport := "chained+fronted"
+	frontedOnly := cs.scheduler != nil && cs.scheduler.CircuitOpen(cfg.CloudConfig)
+	if frontedOnly {
+		transport = "fronted-only"
+		log.Debugf("Circuit open for %v, falling back to fronted-only", cfg.CloudConfig)
+	}
+
+	log.Debugf("Fetching cloud config from %v (%v)", cfg.CloudConfig, cfg.FrontedCloudConfig)
+
+	fetchURL := cfg.CloudConfig
+	if frontedOnly {
+		fetchURL = cfg.FrontedCloudConfig
+	}
+
+	start := time.Now()
+	defer func() {
+		if cs.scheduler != nil {
+			// Record against the URL actually attempted, not always
+			// cfg.CloudConfig - otherwise a fronted-only success would reset
+			// the chained URL's breaker state and the next poll would race
+			// chained+fronted again instead of honoring the cooldown.
+			cs.scheduler.RecordResult(fetchURL, err == nil)
+		}
+		if cs.metrics != nil {
+			cs.metrics.RecordFetch(fetchResultFor(result, err), transport, time.Since(start))
+		}
+	}()
+
+	cb := "?" + uuid.New()
+	nocache := fetchURL + cb
+	req, err := http.NewRequest("GET", nocache, nil)
+	if err != nil {
+		return nil, errors.Wrap(err).WithOp("NewRequest").With("url", nocache)
+	}
+	if cs.lastCloudConfigETag[fetchURL] != "" {
+		// Don't bother fetching if unchanged
+		req.Header.Set(ifNoneMatch, cs.lastCloudConfigETag[fetchURL])
+	} else if cs.seededETag != "" {
+		req.Header.Set(ifNoneMatch, cs.seededETag)
+		cs.seededETag = ""
+	}
+
+	req.Header.Set("Accept", "application/x-gzip")
+	// Prevents intermediate nodes (domain-fronters) from caching the content
+	req.Header.Set("Cache-Control", "no-cache")
+	if !frontedOnly {
+		// Set the fronted URL to lookup the config in parallel using chained and domain fronted servers.
+		req.Header.Set("Lantern-Fronted-URL", cfg.FrontedCloudConfig+cb)
+	}
+
+	id := cs.user.GetUserID()
+	if id != "" {
+		req.Header.Set(userIDHeader, id)
+	}
+	tok := cs.user.GetToken()
+	if tok != "" {
+		req.Header.Set(tokenHeader, tok)
+	}
+
+	// make sure to close the connection after reading the Body
+	// this prevents the occasional EOFs errors we're seeing with
+	// successive requests
+	req.Close = true
+
+	resp, err := cs.httpFetcherFor(cfg).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err).WithOp("fetch-cloud-config").With("url", fetchURL)
+	}
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		errors.Wrap(err).WithOp("dump-response").Report()
+	} else {
+		log.Debugf("Response headers: \n%v", string(dump))
+	}
+	defer func() {
+		if errr := resp.Body.Close(); errr != nil {
+			log.Debugf("Error closing response body: %v", errr)
+		}
+	}()
+
+	if resp.StatusCode == 304 {
+		log.Debugf("Config unchanged in cloud")
+		return nil, nil
+	} else if resp.StatusCode != 200 {
+		return nil, errors.New("Unexpected response status").Response(resp)
+	}
+
+	newEtag := resp.Header.Get(etag)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err).WithOp("read-response").With("url", fetchURL)
+	}
+
+	if RequireSignedCloudConfig {
+		sig, err := cs.fetchSignature(cfg, fetchURL, cb)
+		if err != nil {
+			return nil, errors.Wrap(err).WithOp("fetch-signature").With("url", fetchURL)
+		}
+		if !verifyDetachedSignature(body, sig, trustedKeysFor(cs.user)) {
+			reportSignatureFailure(fetchURL)
+			return nil, ErrSignatureInvalid
+		}
+	} else {
+		log.Debugf("Signature verification disabled, skipping for %v", fetchURL)
+	}
+
+	cs.lastCloudConfigETag[fetchURL] = newEtag
+	gzReader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	log.Debugf("Fetched cloud config")
+	return ioutil.ReadAll(gzReader)
+}
+
+// fetchResultFor classifies a Fetch outcome for metrics.
+func fetchResultFor(bytes []byte, err error) fetchResult {
+	if err != nil {
+		return resultError
+	}
+	if bytes == nil {
+		return resultNotModified
+	}
+	return resultSuccess
+}
+
+// fetchSignature retrieves the detached signature that must accompany
+// cloud.yaml.gz, trying fetchURL's signature first and falling back to the
+// fronted URL's if that fails (unless fetchURL already is the fronted URL),
+// since either may be unreachable depending on network conditions.
+func (cs *CloudSource) fetchSignature(cfg *Config, fetchURL, cacheBust string) ([]byte, error) {
+	urls := []string{fetchURL + sigSuffix}
+	if fetchURL != cfg.FrontedCloudConfig {
+		urls = append(urls, cfg.FrontedCloudConfig+sigSuffix)
+	}
+	var lastErr error
+	for _, u := range urls {
+		req, err := http.NewRequest("GET", u+cacheBust, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Close = true
+		resp, err := cs.httpFetcherFor(cfg).Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sig, err := func() ([]byte, error) {
+			defer resp.Body.Close()
+			if resp.StatusCode != 200 {
+				return nil, errors.New("Unexpected response status").Response(resp)
+			}
+			return ioutil.ReadAll(resp.Body)
+		}()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return sig, nil
+	}
+	return nil, errors.Wrap(lastErr).WithOp("fetch-signature")
+}
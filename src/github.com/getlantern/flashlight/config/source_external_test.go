@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// funcFetcher adapts a function to util.HTTPFetcher for tests.
+type funcFetcher func(req *http.Request) (*http.Response, error)
+
+func (f funcFetcher) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type extTestUser struct {
+	trustedKeys [][]byte
+}
+
+func (u extTestUser) GetUserID() string        { return "user-1" }
+func (u extTestUser) GetToken() string         { return "token-1" }
+func (u extTestUser) GetTrustedKeys() [][]byte { return u.trustedKeys }
+
+func TestExternalHTTPSourceSignProducesValidSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	es := NewExternalHTTPSource("https://config.example.com/fetch", "test-key", priv, extTestUser{}, nil)
+
+	req, err := http.NewRequest("POST", es.url, bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Date", "Mon, 27 Jul 2026 00:00:00 GMT")
+	req.Header.Set("Digest", "SHA-256=deadbeef")
+
+	if err := es.sign(req); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	sigHeader := req.Header.Get("Signature")
+	sigB64 := extractSigParam(t, sigHeader, "signature")
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		t.Fatalf("decoding signature: %v", err)
+	}
+
+	signingString := fmt.Sprintf(
+		"(request-target): %s %s\nhost: %s\ndate: %s\ndigest: %s",
+		"post", req.URL.RequestURI(), req.URL.Host, req.Header.Get("Date"), req.Header.Get("Digest"),
+	)
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		t.Fatalf("signature in Signature header doesn't verify against signingString")
+	}
+	if keyID := extractSigParam(t, sigHeader, "keyId"); keyID != "test-key" {
+		t.Fatalf("keyId = %q, want %q", keyID, "test-key")
+	}
+}
+
+func extractSigParam(t *testing.T, header, param string) string {
+	t.Helper()
+	prefix := param + `="`
+	idx := strings.Index(header, prefix)
+	if idx < 0 {
+		t.Fatalf("Signature header %q missing %s param", header, param)
+	}
+	rest := header[idx+len(prefix):]
+	end := strings.Index(rest, `"`)
+	if end < 0 {
+		t.Fatalf("Signature header %q has unterminated %s param", header, param)
+	}
+	return rest[:end]
+}
+
+func signedResponse(t *testing.T, priv ed25519.PrivateKey, body []byte, omitSig bool) *http.Response {
+	t.Helper()
+	h := http.Header{}
+	if !omitSig {
+		sig := ed25519.Sign(priv, body)
+		h.Set(responseSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Header:     h,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func TestExternalHTTPSourceFetchAcceptsValidResponseSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	body := []byte("client:\n  proxies: []\n")
+
+	es := NewExternalHTTPSource("https://config.example.com/fetch", "test-key",
+		ed25519.PrivateKey(make([]byte, ed25519.PrivateKeySize)),
+		extTestUser{trustedKeys: [][]byte{[]byte(pub)}},
+		funcFetcher(func(req *http.Request) (*http.Response, error) {
+			return signedResponse(t, priv, body, false), nil
+		}))
+
+	got, err := es.Fetch(&Config{})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(got) != string(body) {
+		t.Fatalf("Fetch returned %q, want %q", got, body)
+	}
+}
+
+func TestExternalHTTPSourceFetchRejectsMissingResponseSignature(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	body := []byte("client:\n  proxies: []\n")
+
+	es := NewExternalHTTPSource("https://config.example.com/fetch", "test-key",
+		ed25519.PrivateKey(make([]byte, ed25519.PrivateKeySize)),
+		extTestUser{},
+		funcFetcher(func(req *http.Request) (*http.Response, error) {
+			return signedResponse(t, priv, body, true), nil
+		}))
+
+	if _, err := es.Fetch(&Config{}); err != ErrSignatureInvalid {
+		t.Fatalf("Fetch error = %v, want ErrSignatureInvalid", err)
+	}
+}
+
+func TestExternalHTTPSourceFetchRejectsTamperedResponseBody(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signedBody := []byte("client:\n  proxies: []\n")
+
+	es := NewExternalHTTPSource("https://config.example.com/fetch", "test-key",
+		ed25519.PrivateKey(make([]byte, ed25519.PrivateKeySize)),
+		extTestUser{trustedKeys: [][]byte{[]byte(pub)}},
+		funcFetcher(func(req *http.Request) (*http.Response, error) {
+			resp := signedResponse(t, priv, signedBody, false)
+			// Swap in a body that doesn't match what was signed.
+			resp.Body = ioutil.NopCloser(bytes.NewReader([]byte("client:\n  proxies: [evil]\n")))
+			return resp, nil
+		}))
+
+	if _, err := es.Fetch(&Config{}); err != ErrSignatureInvalid {
+		t.Fatalf("Fetch error = %v, want ErrSignatureInvalid", err)
+	}
+}
@@ -0,0 +1,12 @@
+// Package util holds small, widely-shared helpers used across flashlight,
+// including the HTTP transport abstractions config fetching is built on.
+package util
+
+import "net/http"
+
+// HTTPFetcher is anything that can execute an HTTP request and return its
+// response, abstracting over the particular transport (plain HTTP, chained
+// proxy, domain fronting, HTTP over QUIC) used to reach it.
+type HTTPFetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"net/http"
+
+	"github.com/getlantern/errors"
+)
+
+// ProtocolFetcher falls back through a set of named transports in priority
+// order, trying the next one if the current one fails outright. It backs
+// Config.CloudConfigProtocols (e.g. []string{"h3", "h2", "h1"}), letting a
+// client that can't get QUIC through still fall back to plain HTTP.
+type ProtocolFetcher struct {
+	order    []string
+	fetchers map[string]HTTPFetcher
+}
+
+// NewProtocolFetcher creates a ProtocolFetcher that tries the transports
+// named in order, skipping any name with no corresponding entry in
+// fetchers.
+func NewProtocolFetcher(order []string, fetchers map[string]HTTPFetcher) *ProtocolFetcher {
+	return &ProtocolFetcher{order: order, fetchers: fetchers}
+}
+
+// Do implements HTTPFetcher.
+func (p *ProtocolFetcher) Do(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for _, proto := range p.order {
+		f, ok := p.fetchers[proto]
+		if !ok {
+			continue
+		}
+		resp, err := f.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no usable transport").With("protocols", p.order)
+	}
+	return nil, errors.Wrap(lastErr).WithOp("protocol-fetch")
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// safeStream wraps a quic-go Stream to make Close safe to call concurrently
+// with Write, and to make sure the receive side is torn down too. quic-go's
+// Stream.Close only closes the send side and panics if it races with an
+// in-flight Write, so every Write and Close goes through mu, and Close also
+// cancels the read side so a caller blocked in Read isn't left hanging.
+type safeStream struct {
+	quic.Stream
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newSafeStream(s quic.Stream) *safeStream {
+	return &safeStream{Stream: s}
+}
+
+// Write serializes with Close so it never overlaps a send-side close.
+func (s *safeStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, errStreamClosed
+	}
+	return s.Stream.Write(p)
+}
+
+// Close closes the send side and cancels the receive side, since quic-go
+// otherwise leaves the peer's half of the stream open until it times out on
+// its own.
+func (s *safeStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.Stream.Close()
+	s.Stream.CancelRead(0)
+	return err
+}